@@ -0,0 +1,164 @@
+// Copyright (C) 2014 The Syncthing Authors.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package upgrade
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrOmahaNoUpdate is returned when the Omaha server has no update for the
+// requested app/track combination.
+var ErrOmahaNoUpdate = errors.New("no update available")
+
+// omahaHTTPClient is used for all Omaha requests.
+var omahaHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// OmahaClient talks to an Omaha compatible update server (Nebraska,
+// CoreUpdate, etc) to find out whether a new release is available.
+type OmahaClient struct {
+	// ServerURL is the base URL of the Omaha server, e.g.
+	// "https://update.example.com/v1/update".
+	ServerURL string
+}
+
+// NewOmahaClient returns an OmahaClient talking to the given server URL.
+func NewOmahaClient(serverURL string) *OmahaClient {
+	return &OmahaClient{ServerURL: serverURL}
+}
+
+// omahaRequest mirrors the subset of the Omaha protocol request XML that we
+// need to check for updates.
+type omahaRequest struct {
+	XMLName  xml.Name        `xml:"request"`
+	Protocol string          `xml:"protocol,attr"`
+	App      omahaRequestApp `xml:"app"`
+}
+
+type omahaRequestApp struct {
+	AppID       string              `xml:"appid,attr"`
+	Version     string              `xml:"version,attr"`
+	Track       string              `xml:"track,attr"`
+	UpdateCheck omahaUpdateCheckReq `xml:"updatecheck"`
+}
+
+type omahaUpdateCheckReq struct{}
+
+// omahaResponse mirrors the subset of the Omaha protocol response XML that we
+// care about.
+type omahaResponse struct {
+	XMLName xml.Name         `xml:"response"`
+	App     omahaResponseApp `xml:"app"`
+}
+
+type omahaResponseApp struct {
+	UpdateCheck omahaUpdateCheckResp `xml:"updatecheck"`
+}
+
+type omahaUpdateCheckResp struct {
+	Status   string        `xml:"status,attr"`
+	Urls     omahaUrls     `xml:"urls"`
+	Manifest omahaManifest `xml:"manifest"`
+}
+
+type omahaUrls struct {
+	Url []omahaUrl `xml:"url"`
+}
+
+type omahaUrl struct {
+	Codebase string `xml:"codebase,attr"`
+}
+
+type omahaManifest struct {
+	Version  string        `xml:"version,attr"`
+	Packages omahaPackages `xml:"packages"`
+}
+
+type omahaPackages struct {
+	Package []omahaPackage `xml:"package"`
+}
+
+type omahaPackage struct {
+	Name string `xml:"name,attr"`
+	Hash string `xml:"hash_sha256,attr"`
+	Size int64  `xml:"size,attr"`
+}
+
+// CheckForUpdate asks the Omaha server whether a newer version than
+// currentVersion is available for appID on the given track (e.g. "stable",
+// "beta"). It returns a Release describing the update, or ErrOmahaNoUpdate
+// if the server reports the client is up to date.
+func (c *OmahaClient) CheckForUpdate(appID, currentVersion, track string) (*Release, error) {
+	req := omahaRequest{
+		Protocol: "3.0",
+		App: omahaRequestApp{
+			AppID:   appID,
+			Version: currentVersion,
+			Track:   track,
+		},
+	}
+
+	body, err := xml.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := omahaHTTPClient.Post(c.ServerURL, "text/xml", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("omaha: unexpected status %s", resp.Status)
+	}
+
+	var oresp omahaResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&oresp); err != nil {
+		return nil, err
+	}
+
+	switch oresp.App.UpdateCheck.Status {
+	case "noupdate":
+		return nil, ErrOmahaNoUpdate
+	case "ok":
+		// fall through
+	default:
+		return nil, fmt.Errorf("omaha: server returned status %q", oresp.App.UpdateCheck.Status)
+	}
+
+	var codebase string
+	if urls := oresp.App.UpdateCheck.Urls.Url; len(urls) > 0 {
+		codebase = urls[0].Codebase
+	}
+
+	manifest := oresp.App.UpdateCheck.Manifest
+	rel := &Release{
+		Tag: manifest.Version,
+	}
+	for _, pkg := range manifest.Packages.Package {
+		rel.Assets = append(rel.Assets, Asset{
+			Name: pkg.Name,
+			URL:  codebase + pkg.Name,
+		})
+	}
+
+	return rel, nil
+}
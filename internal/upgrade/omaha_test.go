@@ -0,0 +1,115 @@
+// Copyright (C) 2014 The Syncthing Authors.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package upgrade
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOmahaCheckForUpdateOK(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<response protocol="3.0">
+  <app appid="syncthing">
+    <updatecheck status="ok">
+      <urls>
+        <url codebase="https://update.example.com/dl/"/>
+      </urls>
+      <manifest version="1.2.3">
+        <packages>
+          <package name="syncthing-linux-amd64.tar.gz" hash_sha256="abc" size="123"/>
+        </packages>
+      </manifest>
+    </updatecheck>
+  </app>
+</response>`))
+	}))
+	defer srv.Close()
+
+	c := NewOmahaClient(srv.URL)
+	rel, err := c.CheckForUpdate("syncthing", "1.2.2", "stable")
+	if err != nil {
+		t.Fatalf("CheckForUpdate returned error: %v", err)
+	}
+	if rel.Tag != "1.2.3" {
+		t.Errorf("rel.Tag = %q, want %q", rel.Tag, "1.2.3")
+	}
+	if len(rel.Assets) != 1 {
+		t.Fatalf("len(rel.Assets) = %d, want 1", len(rel.Assets))
+	}
+
+	wantURL := "https://update.example.com/dl/syncthing-linux-amd64.tar.gz"
+	if rel.Assets[0].URL != wantURL {
+		t.Errorf("rel.Assets[0].URL = %q, want %q", rel.Assets[0].URL, wantURL)
+	}
+	if rel.Assets[0].Name != "syncthing-linux-amd64.tar.gz" {
+		t.Errorf("rel.Assets[0].Name = %q, want %q", rel.Assets[0].Name, "syncthing-linux-amd64.tar.gz")
+	}
+}
+
+func TestOmahaCheckForUpdateNoUpdate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<response protocol="3.0"><app appid="syncthing"><updatecheck status="noupdate"/></app></response>`))
+	}))
+	defer srv.Close()
+
+	c := NewOmahaClient(srv.URL)
+	if _, err := c.CheckForUpdate("syncthing", "1.2.3", "stable"); err != ErrOmahaNoUpdate {
+		t.Errorf("CheckForUpdate returned %v, want ErrOmahaNoUpdate", err)
+	}
+}
+
+func TestOmahaCheckForUpdateUnknownStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<response protocol="3.0"><app appid="syncthing"><updatecheck status="error-internal"/></app></response>`))
+	}))
+	defer srv.Close()
+
+	c := NewOmahaClient(srv.URL)
+	if _, err := c.CheckForUpdate("syncthing", "1.2.3", "stable"); err == nil {
+		t.Error("CheckForUpdate should have returned an error for an unknown status")
+	}
+}
+
+func TestOmahaCheckForUpdateHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := NewOmahaClient(srv.URL)
+	if _, err := c.CheckForUpdate("syncthing", "1.2.3", "stable"); err == nil {
+		t.Error("CheckForUpdate should have returned an error for a non-200 response")
+	}
+}
+
+func TestOmahaCheckForUpdateBadXML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`not xml`))
+	}))
+	defer srv.Close()
+
+	c := NewOmahaClient(srv.URL)
+	if _, err := c.CheckForUpdate("syncthing", "1.2.3", "stable"); err == nil {
+		t.Error("CheckForUpdate should have returned an error for malformed XML")
+	}
+}
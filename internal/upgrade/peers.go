@@ -0,0 +1,178 @@
+// Copyright (C) 2014 The Syncthing Authors.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package upgrade
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// PeerObservedVersion describes a version advertised by one or more
+// connected BEP peers that is newer than the version we are running.
+type PeerObservedVersion struct {
+	Version   string    `json:"version"`
+	Devices   int       `json:"devices"`
+	FirstSeen time.Time `json:"firstSeen"`
+}
+
+// peerVersion tracks the set of devices that have advertised a given
+// version, and when that version was first observed.
+type peerVersion struct {
+	devices   map[string]struct{}
+	firstSeen time.Time
+}
+
+// PeerVersions collects the versions advertised by connected peers during
+// the BEP handshake, so that a cluster can learn about available upgrades
+// from the network even when the release feed is unreachable.
+//
+// This type only provides the bookkeeping: nothing in this tree yet calls
+// Record from the BEP handshake, and there is no REST handler serving
+// Observed. Wiring those up is pending work, not part of this commit.
+type PeerVersions struct {
+	mut      sync.Mutex
+	versions map[string]*peerVersion
+}
+
+// NewPeerVersions returns an empty PeerVersions tracker.
+func NewPeerVersions() *PeerVersions {
+	return &PeerVersions{
+		versions: make(map[string]*peerVersion),
+	}
+}
+
+// Record notes that deviceID has advertised clientVersion. If clientVersion
+// is not strictly newer than ours (as decided by CompareVersions), it is
+// ignored. It is meant to be called with the ClientVersion field of the BEP
+// handshake for each connected peer, but no such call site exists in this
+// tree yet.
+func (p *PeerVersions) Record(deviceID, ourVersion, clientVersion string) {
+	if CompareVersions(clientVersion, ourVersion) <= 0 {
+		return
+	}
+
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	pv, ok := p.versions[clientVersion]
+	if !ok {
+		pv = &peerVersion{
+			devices:   make(map[string]struct{}),
+			firstSeen: time.Now(),
+		}
+		p.versions[clientVersion] = pv
+	}
+	pv.devices[deviceID] = struct{}{}
+}
+
+// Observed returns the currently tracked peer-observed versions. Intended
+// to back a REST endpoint at /rest/system/upgrade/peers, but no such
+// handler exists in this tree yet.
+func (p *PeerVersions) Observed() []PeerObservedVersion {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	observed := make([]PeerObservedVersion, 0, len(p.versions))
+	for version, pv := range p.versions {
+		observed = append(observed, PeerObservedVersion{
+			Version:   version,
+			Devices:   len(pv.devices),
+			FirstSeen: pv.firstSeen,
+		})
+	}
+	return observed
+}
+
+// ShouldAutoUpgrade reports whether at least minDevices distinct devices
+// have advertised a version on the same major.minor track as candidate, and
+// the earliest such version was first observed at least minAge ago, making
+// it eligible for an automatic peer-triggered upgrade. The age is that of
+// the track's first observation; how long each individual device has been
+// advertising it is not tracked.
+func (p *PeerVersions) ShouldAutoUpgrade(candidate string, minDevices int, minAge time.Duration) bool {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	track := majorMinor(candidate)
+	devices := make(map[string]struct{})
+	var firstSeen time.Time
+
+	for version, pv := range p.versions {
+		if majorMinor(version) != track {
+			continue
+		}
+		for id := range pv.devices {
+			devices[id] = struct{}{}
+		}
+		if firstSeen.IsZero() || pv.firstSeen.Before(firstSeen) {
+			firstSeen = pv.firstSeen
+		}
+	}
+
+	if len(devices) < minDevices {
+		return false
+	}
+	return !firstSeen.IsZero() && time.Since(firstSeen) >= minAge
+}
+
+// majorMinor returns the "major.minor" prefix of a dotted version string,
+// ignoring any leading "v" and any patch/prerelease/build suffix.
+func majorMinor(v string) string {
+	v = strings.TrimPrefix(strings.TrimPrefix(v, "v"), "V")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.SplitN(v, ".", 3)
+	if len(fields) < 2 {
+		return v
+	}
+	return fields[0] + "." + fields[1]
+}
+
+// CheckPeerTriggeredUpgrade checks whether peers have converged on a newer
+// version and, if so, fetches the matching release with fetch and upgrades
+// to it via apply. fetch is expected to look up and verify a signed release
+// for the given track from the configured release feed; it is only called
+// once the peer threshold has been met, so an unreachable release server
+// does not block normal operation. apply is called with the fetched
+// release to perform the actual upgrade; callers normally pass To, with a
+// fake substituted in tests so the trigger path can be exercised without
+// replacing the running binary.
+func (p *PeerVersions) CheckPeerTriggeredUpgrade(minDevices int, minAge time.Duration, fetch func(track string) (Release, error), apply func(Release) error) error {
+	for _, ov := range p.Observed() {
+		if !p.ShouldAutoUpgrade(ov.Version, minDevices, minAge) {
+			continue
+		}
+
+		rel, err := fetch(majorMinor(ov.Version))
+		if err != nil {
+			continue
+		}
+		if CompareVersions(rel.Tag, ov.Version) < 0 {
+			// The release feed doesn't yet have what the peers are
+			// advertising; nothing to do until it does.
+			continue
+		}
+		return apply(rel)
+	}
+	return nil
+}
+
+// DefaultPeerVersions is the process-wide peer version tracker intended to
+// be fed by the BEP connection handshake and consulted by the REST API,
+// once those integration points exist (see PeerVersions).
+var DefaultPeerVersions = NewPeerVersions()
@@ -0,0 +1,175 @@
+// Copyright (C) 2014 The Syncthing Authors.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package upgrade
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPeerVersionsRecordIgnoresNonNewer(t *testing.T) {
+	p := NewPeerVersions()
+
+	p.Record("device-1", "v1.2.3", "v1.2.3")
+	p.Record("device-2", "v1.2.3", "v1.2.2")
+	if observed := p.Observed(); len(observed) != 0 {
+		t.Errorf("Observed() = %v, want none recorded for equal/older versions", observed)
+	}
+
+	p.Record("device-3", "v1.2.3", "v1.3.0")
+	observed := p.Observed()
+	if len(observed) != 1 {
+		t.Fatalf("Observed() = %v, want exactly one entry", observed)
+	}
+	if observed[0].Version != "v1.3.0" || observed[0].Devices != 1 {
+		t.Errorf("Observed()[0] = %+v, want {Version: v1.3.0, Devices: 1}", observed[0])
+	}
+}
+
+func TestPeerVersionsRecordDedupesDevices(t *testing.T) {
+	p := NewPeerVersions()
+
+	p.Record("device-1", "v1.2.3", "v1.3.0")
+	p.Record("device-1", "v1.2.3", "v1.3.0")
+	p.Record("device-2", "v1.2.3", "v1.3.0")
+
+	observed := p.Observed()
+	if len(observed) != 1 || observed[0].Devices != 2 {
+		t.Errorf("Observed() = %v, want a single entry with Devices: 2", observed)
+	}
+}
+
+func TestPeerVersionsShouldAutoUpgradeDeviceThreshold(t *testing.T) {
+	p := NewPeerVersions()
+	p.Record("device-1", "v1.2.3", "v1.3.0")
+
+	if p.ShouldAutoUpgrade("v1.3.0", 2, 0) {
+		t.Error("ShouldAutoUpgrade should be false with only 1 of 2 required devices")
+	}
+
+	p.Record("device-2", "v1.2.3", "v1.3.0")
+	if !p.ShouldAutoUpgrade("v1.3.0", 2, 0) {
+		t.Error("ShouldAutoUpgrade should be true once 2 of 2 required devices have reported")
+	}
+}
+
+func TestPeerVersionsShouldAutoUpgradeAgeThreshold(t *testing.T) {
+	p := NewPeerVersions()
+	p.Record("device-1", "v1.2.3", "v1.3.0")
+
+	if p.ShouldAutoUpgrade("v1.3.0", 1, time.Hour) {
+		t.Error("ShouldAutoUpgrade should be false before minAge has elapsed")
+	}
+	if !p.ShouldAutoUpgrade("v1.3.0", 1, 0) {
+		t.Error("ShouldAutoUpgrade should be true with minAge: 0")
+	}
+}
+
+func TestPeerVersionsShouldAutoUpgradeMatchesByMajorMinor(t *testing.T) {
+	p := NewPeerVersions()
+	p.Record("device-1", "v1.2.3", "v1.3.0")
+	p.Record("device-2", "v1.2.3", "v1.3.1")
+
+	// Both v1.3.0 and v1.3.1 share the same major.minor track, so a
+	// candidate of either version should count both devices.
+	if !p.ShouldAutoUpgrade("v1.3.0", 2, 0) {
+		t.Error("ShouldAutoUpgrade should count devices across patch versions on the same major.minor track")
+	}
+	if p.ShouldAutoUpgrade("v2.0.0", 1, 0) {
+		t.Error("ShouldAutoUpgrade should not match a different major.minor track")
+	}
+}
+
+func TestCheckPeerTriggeredUpgradeSkipsWhenReleaseOlderThanObserved(t *testing.T) {
+	p := NewPeerVersions()
+	p.Record("device-1", "v1.2.3", "v1.4.0")
+
+	called := false
+	fetch := func(track string) (Release, error) {
+		called = true
+		return Release{Tag: "v1.3.0"}, nil
+	}
+	apply := func(rel Release) error {
+		t.Fatal("apply should not be called when the fetched release is older than observed")
+		return nil
+	}
+
+	if err := p.CheckPeerTriggeredUpgrade(1, 0, fetch, apply); err != nil {
+		t.Errorf("CheckPeerTriggeredUpgrade returned %v, want nil", err)
+	}
+	if !called {
+		t.Error("fetch should have been called once the peer threshold was met")
+	}
+}
+
+func TestCheckPeerTriggeredUpgradeSkipsBelowThreshold(t *testing.T) {
+	p := NewPeerVersions()
+	p.Record("device-1", "v1.2.3", "v1.4.0")
+
+	fetch := func(track string) (Release, error) {
+		t.Fatal("fetch should not be called below the peer threshold")
+		return Release{}, nil
+	}
+	apply := func(rel Release) error {
+		t.Fatal("apply should not be called below the peer threshold")
+		return nil
+	}
+
+	if err := p.CheckPeerTriggeredUpgrade(2, 0, fetch, apply); err != nil {
+		t.Errorf("CheckPeerTriggeredUpgrade returned %v, want nil", err)
+	}
+}
+
+func TestCheckPeerTriggeredUpgradeSkipsOnFetchError(t *testing.T) {
+	p := NewPeerVersions()
+	p.Record("device-1", "v1.2.3", "v1.4.0")
+
+	fetch := func(track string) (Release, error) {
+		return Release{}, errors.New("release feed unreachable")
+	}
+	apply := func(rel Release) error {
+		t.Fatal("apply should not be called when fetch fails")
+		return nil
+	}
+
+	if err := p.CheckPeerTriggeredUpgrade(1, 0, fetch, apply); err != nil {
+		t.Errorf("CheckPeerTriggeredUpgrade returned %v, want nil", err)
+	}
+}
+
+func TestCheckPeerTriggeredUpgradeApplies(t *testing.T) {
+	p := NewPeerVersions()
+	p.Record("device-1", "v1.2.3", "v1.4.0")
+
+	fetch := func(track string) (Release, error) {
+		return Release{Tag: "v1.4.0"}, nil
+	}
+
+	var applied Release
+	applyErr := errors.New("simulated upgrade result")
+	apply := func(rel Release) error {
+		applied = rel
+		return applyErr
+	}
+
+	if err := p.CheckPeerTriggeredUpgrade(1, 0, fetch, apply); err != applyErr {
+		t.Errorf("CheckPeerTriggeredUpgrade returned %v, want the error from apply", err)
+	}
+	if applied.Tag != "v1.4.0" {
+		t.Errorf("apply was called with Tag %q, want %q", applied.Tag, "v1.4.0")
+	}
+}
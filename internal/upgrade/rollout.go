@@ -0,0 +1,63 @@
+// Copyright (C) 2014 The Syncthing Authors.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package upgrade
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// ErrRolloutDeferred is returned by To when a release carries a
+// RolloutPolicy and this device's bucket hasn't been reached yet.
+var ErrRolloutDeferred = errors.New("upgrade deferred by staged rollout policy")
+
+// LocalDeviceID is the ID of the running device, used to deterministically
+// bucket staged rollouts. It must be set by the caller (normally once, at
+// startup) before To is used with a release carrying a RolloutPolicy.
+var LocalDeviceID string
+
+// RolloutPolicy controls staged ("canary") rollout of a release: only a
+// deterministic, stable subset of devices will upgrade to it at a time.
+type RolloutPolicy struct {
+	// RolloutPercent is the percentage of devices, 0-100, that should
+	// receive this release: 0 means nobody, 100 means everyone. A release
+	// with no RolloutPolicy at all is also treated as everyone.
+	RolloutPercent int `json:"rolloutPercent"`
+	// RolloutSalt varies the bucket assignment between releases that
+	// would otherwise hash to the same bucket.
+	RolloutSalt string `json:"rolloutSalt"`
+}
+
+// rolloutIncludes reports whether deviceID falls within the percentage of
+// devices that rel.RolloutPolicy allows to upgrade.
+func rolloutIncludes(deviceID string, rel Release) bool {
+	if rel.RolloutPolicy == nil || rel.RolloutPolicy.RolloutPercent >= 100 {
+		return true
+	}
+	if rel.RolloutPolicy.RolloutPercent <= 0 {
+		return false
+	}
+	return rolloutBucket(deviceID, rel.Tag, rel.RolloutPolicy.RolloutSalt) < rel.RolloutPolicy.RolloutPercent
+}
+
+// rolloutBucket deterministically maps (deviceID, tag, salt) to a bucket in
+// [0, 100), by taking sha256(deviceID + "|" + tag + "|" + salt) mod 100.
+func rolloutBucket(deviceID, tag, salt string) int {
+	sum := sha256.Sum256([]byte(deviceID + "|" + tag + "|" + salt))
+	n := new(big.Int).SetBytes(sum[:])
+	return int(n.Mod(n, big.NewInt(100)).Int64())
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2014 The Syncthing Authors.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package upgrade
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRolloutBucketDeterministic(t *testing.T) {
+	a := rolloutBucket("device-1", "v1.2.3", "salt")
+	b := rolloutBucket("device-1", "v1.2.3", "salt")
+	if a != b {
+		t.Errorf("rolloutBucket is not deterministic: got %d and %d for identical inputs", a, b)
+	}
+	if a < 0 || a >= 100 {
+		t.Errorf("rolloutBucket returned %d, want [0, 100)", a)
+	}
+}
+
+func TestRolloutBucketDistribution(t *testing.T) {
+	// A large number of distinct device IDs should spread roughly evenly
+	// across the 100 buckets; this is not a strict statistical test, just
+	// a sanity check that we're not collapsing everything into a handful
+	// of buckets.
+	counts := make([]int, 100)
+	const n = 10000
+	for i := 0; i < n; i++ {
+		b := rolloutBucket(fmt.Sprintf("device-%d", i), "v1.2.3", "salt")
+		counts[b]++
+	}
+
+	empty := 0
+	for _, c := range counts {
+		if c == 0 {
+			empty++
+		}
+	}
+	if empty > 5 {
+		t.Errorf("%d/100 buckets got no devices out of %d samples, distribution looks skewed", empty, n)
+	}
+}
+
+func TestRolloutIncludes(t *testing.T) {
+	base := Release{Tag: "v1.2.3"}
+
+	if !rolloutIncludes("device-1", base) {
+		t.Error("rolloutIncludes with no RolloutPolicy should include everyone")
+	}
+
+	full := base
+	full.RolloutPolicy = &RolloutPolicy{RolloutPercent: 100, RolloutSalt: "salt"}
+	if !rolloutIncludes("device-1", full) {
+		t.Error("rolloutIncludes with RolloutPercent: 100 should include everyone")
+	}
+
+	none := base
+	none.RolloutPolicy = &RolloutPolicy{RolloutPercent: 0, RolloutSalt: "salt"}
+	if rolloutIncludes("device-1", none) {
+		t.Error("rolloutIncludes with RolloutPercent: 0 should include no one")
+	}
+
+	// At a mid percentage, whether a device is included must be
+	// consistent with its raw bucket, and consistent across calls.
+	mid := base
+	mid.RolloutPolicy = &RolloutPolicy{RolloutPercent: 50, RolloutSalt: "salt"}
+	for _, id := range []string{"device-1", "device-2", "device-3", "device-4"} {
+		want := rolloutBucket(id, mid.Tag, mid.RolloutPolicy.RolloutSalt) < 50
+		got := rolloutIncludes(id, mid)
+		if got != want {
+			t.Errorf("rolloutIncludes(%q, 50%%) = %v, want %v", id, got, want)
+		}
+		if got2 := rolloutIncludes(id, mid); got2 != got {
+			t.Errorf("rolloutIncludes(%q, 50%%) is not stable across calls: got %v then %v", id, got, got2)
+		}
+	}
+}
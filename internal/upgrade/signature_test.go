@@ -0,0 +1,114 @@
+// Copyright (C) 2014 The Syncthing Authors.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package upgrade
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestVerifyAssetSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("this is the upgrade binary contents")
+	sig := ed25519.Sign(priv, data)
+
+	old := UpgradeSigningKey
+	defer func() { UpgradeSigningKey = old }()
+	UpgradeSigningKey = base64.StdEncoding.EncodeToString(pub)
+
+	asset := Asset{
+		Name:      "syncthing-linux-amd64.tar.gz",
+		Signature: base64.StdEncoding.EncodeToString(sig),
+	}
+
+	if err := VerifyAssetSignature(asset, data); err != nil {
+		t.Errorf("VerifyAssetSignature with a valid signature returned %v, want nil", err)
+	}
+
+	tampered := []byte("this is NOT the upgrade binary contents")
+	if err := VerifyAssetSignature(asset, tampered); err != ErrSignatureInvalid {
+		t.Errorf("VerifyAssetSignature with tampered data returned %v, want ErrSignatureInvalid", err)
+	}
+
+	garbage := Asset{Name: asset.Name, Signature: "not-base64!!"}
+	if err := VerifyAssetSignature(garbage, data); err != ErrSignatureInvalid {
+		t.Errorf("VerifyAssetSignature with garbage signature returned %v, want ErrSignatureInvalid", err)
+	}
+
+	empty := Asset{Name: asset.Name}
+	if err := VerifyAssetSignature(empty, data); err != ErrSignatureInvalid {
+		t.Errorf("VerifyAssetSignature with empty signature returned %v, want ErrSignatureInvalid", err)
+	}
+}
+
+func TestVerifyAssetSignatureUnsetKey(t *testing.T) {
+	old := UpgradeSigningKey
+	defer func() { UpgradeSigningKey = old }()
+	UpgradeSigningKey = ""
+
+	asset := Asset{Name: "syncthing-linux-amd64.tar.gz"}
+	if err := VerifyAssetSignature(asset, []byte("anything")); err != nil {
+		t.Errorf("VerifyAssetSignature with unset UpgradeSigningKey returned %v, want nil", err)
+	}
+}
+
+func TestVerifyReleaseAssets(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("this is the upgrade binary contents")
+	sig := ed25519.Sign(priv, data)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	old := UpgradeSigningKey
+	defer func() { UpgradeSigningKey = old }()
+	UpgradeSigningKey = base64.StdEncoding.EncodeToString(pub)
+
+	goodRel := Release{
+		Tag: "v1.2.3",
+		Assets: []Asset{
+			{Name: "syncthing-linux-amd64.tar.gz", URL: srv.URL, Signature: base64.StdEncoding.EncodeToString(sig)},
+		},
+	}
+	if err := VerifyReleaseAssets(goodRel); err != nil {
+		t.Errorf("VerifyReleaseAssets with a validly signed asset returned %v, want nil", err)
+	}
+
+	badRel := Release{
+		Tag: "v1.2.3",
+		Assets: []Asset{
+			{Name: "syncthing-linux-amd64.tar.gz", URL: srv.URL, Signature: "not-base64!!"},
+		},
+	}
+	if err := VerifyReleaseAssets(badRel); err != ErrSignatureInvalid {
+		t.Errorf("VerifyReleaseAssets with a bad signature returned %v, want ErrSignatureInvalid", err)
+	}
+}
@@ -18,21 +18,25 @@ package upgrade
 
 import (
 	"errors"
-	"strconv"
-	"strings"
 
 	"github.com/calmh/osext"
 )
 
 type Release struct {
-	Tag        string  `json:"tag_name"`
-	Prerelease bool    `json:"prerelease"`
-	Assets     []Asset `json:"assets"`
+	Tag           string         `json:"tag_name"`
+	Prerelease    bool           `json:"prerelease"`
+	Assets        []Asset        `json:"assets"`
+	RolloutPolicy *RolloutPolicy `json:"rollout,omitempty"`
 }
 
 type Asset struct {
 	URL  string `json:"url"`
 	Name string `json:"name"`
+	// Signature is the base64-encoded ed25519 detached signature of the
+	// asset contents, as published alongside it (e.g. in an "asset.sig"
+	// sibling file). It is verified against UpgradeSigningKey before the
+	// asset is used to replace the running binary.
+	Signature string `json:"signature,omitempty"`
 }
 
 var (
@@ -49,6 +53,14 @@ func init() {
 
 // A wrapper around actual implementations
 func To(rel Release) error {
+	if !rolloutIncludes(LocalDeviceID, rel) {
+		return ErrRolloutDeferred
+	}
+
+	if err := VerifyReleaseAssets(rel); err != nil {
+		return err
+	}
+
 	select {
 	case <-upgradeUnlocked:
 		path, err := osext.Executable()
@@ -67,7 +79,11 @@ func To(rel Release) error {
 	}
 }
 
-// A wrapper around actual implementations
+// A wrapper around actual implementations. ToURL upgrades from a raw
+// download URL with no accompanying Release metadata, so unlike To it has
+// no Asset.Signature to check and does not go through
+// VerifyReleaseAssets/rolloutIncludes; it predates signed, staged
+// releases and remains for direct-URL upgrades (e.g. from the CLI).
 func ToURL(url string) error {
 	select {
 	case <-upgradeUnlocked:
@@ -86,120 +102,3 @@ func ToURL(url string) error {
 		return ErrUpgradeInProgress
 	}
 }
-
-// Returns 1 if a>b, -1 if a<b and 0 if they are equal
-func CompareVersions(a, b string) int {
-	arel, apre := versionParts(a)
-	brel, bpre := versionParts(b)
-
-	minlen := len(arel)
-	if l := len(brel); l < minlen {
-		minlen = l
-	}
-
-	// First compare major-minor-patch versions
-	for i := 0; i < minlen; i++ {
-		if arel[i] < brel[i] {
-			return -1
-		}
-		if arel[i] > brel[i] {
-			return 1
-		}
-	}
-
-	// Longer version is newer, when the preceding parts are equal
-	if len(arel) < len(brel) {
-		return -1
-	}
-	if len(arel) > len(brel) {
-		return 1
-	}
-
-	// Prerelease versions are older, if the versions are the same
-	if len(apre) == 0 && len(bpre) > 0 {
-		return 1
-	}
-	if len(apre) > 0 && len(bpre) == 0 {
-		return -1
-	}
-
-	minlen = len(apre)
-	if l := len(bpre); l < minlen {
-		minlen = l
-	}
-
-	// Compare prerelease strings
-	for i := 0; i < minlen; i++ {
-		switch av := apre[i].(type) {
-		case int:
-			switch bv := bpre[i].(type) {
-			case int:
-				if av < bv {
-					return -1
-				}
-				if av > bv {
-					return 1
-				}
-			case string:
-				return -1
-			}
-		case string:
-			switch bv := bpre[i].(type) {
-			case int:
-				return 1
-			case string:
-				if av < bv {
-					return -1
-				}
-				if av > bv {
-					return 1
-				}
-			}
-		}
-	}
-
-	// If all else is equal, longer prerelease string is newer
-	if len(apre) < len(bpre) {
-		return -1
-	}
-	if len(apre) > len(bpre) {
-		return 1
-	}
-
-	// Looks like they're actually the same
-	return 0
-}
-
-// Split a version into parts.
-// "1.2.3-beta.2" -> []int{1, 2, 3}, []interface{}{"beta", 2}
-func versionParts(v string) ([]int, []interface{}) {
-	if strings.HasPrefix(v, "v") || strings.HasPrefix(v, "V") {
-		// Strip initial 'v' or 'V' prefix if present.
-		v = v[1:]
-	}
-	parts := strings.SplitN(v, "+", 2)
-	parts = strings.SplitN(parts[0], "-", 2)
-	fields := strings.Split(parts[0], ".")
-
-	release := make([]int, len(fields))
-	for i, s := range fields {
-		v, _ := strconv.Atoi(s)
-		release[i] = v
-	}
-
-	var prerelease []interface{}
-	if len(parts) > 1 {
-		fields = strings.Split(parts[1], ".")
-		prerelease = make([]interface{}, len(fields))
-		for i, s := range fields {
-			v, err := strconv.Atoi(s)
-			if err == nil {
-				prerelease[i] = v
-			} else {
-				prerelease[i] = s
-			}
-		}
-	}
-
-	return release, prerelease
-}
@@ -0,0 +1,207 @@
+// Copyright (C) 2014 The Syncthing Authors.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package upgrade
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidVersion is returned by ParseVersion when the given string isn't
+// a dotted numeric version, optionally followed by a "-prerelease" and/or
+// a "+build" suffix.
+var ErrInvalidVersion = errors.New("invalid version")
+
+// numericIdentifier matches a SemVer 2.0.0 numeric prerelease identifier:
+// either "0" or a run of digits with no leading zero.
+var numericIdentifier = regexp.MustCompile(`^(0|[1-9][0-9]*)$`)
+
+// Version is a parsed, comparable representation of a dotted version
+// string such as "v1.2.3-beta.11+build.5".
+type Version struct {
+	Release    []int
+	Prerelease []string
+	Build      string
+}
+
+// ParseVersion parses a version string into its release, prerelease and
+// build components, split as in SemVer 2.0.0 (with an optional leading
+// "v"/"V", which Syncthing versions carry and SemVer does not). It is more
+// lenient than the SemVer grammar: any number of numeric release fields is
+// accepted (e.g. "1.2"), and prerelease and build identifiers are not
+// validated.
+func ParseVersion(v string) (Version, error) {
+	v = strings.TrimPrefix(strings.TrimPrefix(v, "v"), "V")
+
+	var build string
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		build = v[i+1:]
+		v = v[:i]
+	}
+
+	var prerelease string
+	hasPrerelease := false
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		prerelease = v[i+1:]
+		v = v[:i]
+		hasPrerelease = true
+	}
+
+	fields := strings.Split(v, ".")
+	release := make([]int, len(fields))
+	for i, s := range fields {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return Version{}, ErrInvalidVersion
+		}
+		release[i] = n
+	}
+
+	var pre []string
+	if hasPrerelease {
+		pre = strings.Split(prerelease, ".")
+	}
+
+	return Version{
+		Release:    release,
+		Prerelease: pre,
+		Build:      build,
+	}, nil
+}
+
+// Compare returns 1 if v has higher precedence than o, -1 if lower, and 0
+// if they are equal in precedence. Build metadata is ignored, per SemVer.
+func (v Version) Compare(o Version) int {
+	if c := compareRelease(v.Release, o.Release); c != 0 {
+		return c
+	}
+
+	// A version with a prerelease has lower precedence than the same
+	// version without one.
+	if len(v.Prerelease) == 0 && len(o.Prerelease) > 0 {
+		return 1
+	}
+	if len(v.Prerelease) > 0 && len(o.Prerelease) == 0 {
+		return -1
+	}
+
+	minlen := len(v.Prerelease)
+	if l := len(o.Prerelease); l < minlen {
+		minlen = l
+	}
+	for i := 0; i < minlen; i++ {
+		if c := compareIdentifier(v.Prerelease[i], o.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+
+	// A larger set of prerelease fields has higher precedence, when all
+	// preceding fields are equal.
+	if len(v.Prerelease) < len(o.Prerelease) {
+		return -1
+	}
+	if len(v.Prerelease) > len(o.Prerelease) {
+		return 1
+	}
+
+	return 0
+}
+
+// compareRelease compares two release version number sequences
+// (major.minor.patch...), treating a missing trailing field as zero.
+func compareRelease(a, b []int) int {
+	minlen := len(a)
+	if l := len(b); l < minlen {
+		minlen = l
+	}
+	for i := 0; i < minlen; i++ {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+	for i := minlen; i < len(a); i++ {
+		if a[i] != 0 {
+			return 1
+		}
+	}
+	for i := minlen; i < len(b); i++ {
+		if b[i] != 0 {
+			return -1
+		}
+	}
+	return 0
+}
+
+// compareIdentifier compares two dot-separated prerelease identifiers per
+// SemVer 2.0.0 precedence rules: numeric identifiers are always lower
+// precedence than alphanumeric ones, numeric identifiers compare
+// numerically, and alphanumeric identifiers compare in ASCII order.
+func compareIdentifier(a, b string) int {
+	aNum := numericIdentifier.MatchString(a)
+	bNum := numericIdentifier.MatchString(b)
+
+	switch {
+	case aNum && bNum:
+		// Both numeric and validated by the regexp, so these always parse.
+		an, _ := strconv.Atoi(a)
+		bn, _ := strconv.Atoi(b)
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		default:
+			return 0
+		}
+	case aNum && !bNum:
+		return -1
+	case !aNum && bNum:
+		return 1
+	default:
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		default:
+			return 0
+		}
+	}
+}
+
+// CompareVersions returns 1 if a has higher precedence than b, -1 if lower,
+// and 0 if they are equal, per SemVer 2.0.0 precedence rules. Unparseable
+// input is treated as lower precedence than any valid version.
+func CompareVersions(a, b string) int {
+	av, aerr := ParseVersion(a)
+	bv, berr := ParseVersion(b)
+
+	switch {
+	case aerr != nil && berr != nil:
+		return 0
+	case aerr != nil:
+		return -1
+	case berr != nil:
+		return 1
+	}
+
+	return av.Compare(bv)
+}
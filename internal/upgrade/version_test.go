@@ -0,0 +1,142 @@
+// Copyright (C) 2014 The Syncthing Authors.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package upgrade
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		in      string
+		release []int
+		pre     []string
+		build   string
+	}{
+		{"v1.2.3", []int{1, 2, 3}, nil, ""},
+		{"V1.2.3", []int{1, 2, 3}, nil, ""},
+		{"1.2.3-beta.2", []int{1, 2, 3}, []string{"beta", "2"}, ""},
+		{"1.2.3-alpha10", []int{1, 2, 3}, []string{"alpha10"}, ""},
+		{"1.2.3+build.5", []int{1, 2, 3}, nil, "build.5"},
+		{"1.2.3-rc.1+build.5", []int{1, 2, 3}, []string{"rc", "1"}, "build.5"},
+		{"0.14.20", []int{0, 14, 20}, nil, ""},
+	}
+
+	for _, tc := range cases {
+		v, err := ParseVersion(tc.in)
+		if err != nil {
+			t.Errorf("ParseVersion(%q) returned error: %v", tc.in, err)
+			continue
+		}
+		if !intSliceEqual(v.Release, tc.release) {
+			t.Errorf("ParseVersion(%q).Release = %v, want %v", tc.in, v.Release, tc.release)
+		}
+		if !strSliceEqual(v.Prerelease, tc.pre) {
+			t.Errorf("ParseVersion(%q).Prerelease = %v, want %v", tc.in, v.Prerelease, tc.pre)
+		}
+		if v.Build != tc.build {
+			t.Errorf("ParseVersion(%q).Build = %q, want %q", tc.in, v.Build, tc.build)
+		}
+	}
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	for _, in := range []string{"", "abc", "1.x.3"} {
+		if _, err := ParseVersion(in); err == nil {
+			t.Errorf("ParseVersion(%q) should have returned an error", in)
+		}
+	}
+}
+
+// TestCompareVersionsPrecedenceChain checks the official semver.org
+// example precedence chain:
+// 1.0.0-alpha < 1.0.0-alpha.1 < 1.0.0-alpha.beta < 1.0.0-beta <
+// 1.0.0-beta.2 < 1.0.0-beta.11 < 1.0.0-rc.1 < 1.0.0
+func TestCompareVersionsPrecedenceChain(t *testing.T) {
+	chain := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+	}
+
+	for i := 0; i < len(chain); i++ {
+		if c := CompareVersions(chain[i], chain[i]); c != 0 {
+			t.Errorf("CompareVersions(%q, %q) = %d, want 0", chain[i], chain[i], c)
+		}
+		for j := i + 1; j < len(chain); j++ {
+			if c := CompareVersions(chain[i], chain[j]); c != -1 {
+				t.Errorf("CompareVersions(%q, %q) = %d, want -1", chain[i], chain[j], c)
+			}
+			if c := CompareVersions(chain[j], chain[i]); c != 1 {
+				t.Errorf("CompareVersions(%q, %q) = %d, want 1", chain[j], chain[i], c)
+			}
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.4", "1.2.3", 1},
+		{"1.2.3", "1.2.4", -1},
+		{"1.3.0", "1.2.9", 1},
+		{"2.0.0", "1.9.9", 1},
+		{"1.2.3", "1.2", 1},
+		{"1.2.0", "1.2", 0},
+		{"1.2.3-alpha10", "1.2.3-alpha9", -1}, // "alpha10" and "alpha9" compare as strings, not numbers
+		{"1.2.3-alpha.10", "1.2.3-alpha.9", 1},
+		{"1.2.3-alpha.01", "1.2.3-alpha.1", 1}, // "01" has a leading zero so is alphanumeric, and alphanumeric outranks numeric "1"
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2.3+build1", "1.2.3+build2", 0},
+		{"1.2.3-beta+build1", "1.2.3-beta+build2", 0},
+	}
+
+	for _, tc := range cases {
+		if got := CompareVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func intSliceEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func strSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}